@@ -0,0 +1,67 @@
+package api
+
+// RebalanceChannelRequest describes a request to rebalance liquidity from one
+// of our channels into another by routing a self-payment through a specified
+// peer.
+type RebalanceChannelRequest struct {
+	AmountSat                uint64 `json:"amountSat"`
+	ReceiveThroughNodePubkey string `json:"receiveThroughNodePubkey"`
+
+	// Mode selects how the rebalance is carried out. The zero value ("")
+	// keeps the original behaviour of using the external rebalance order
+	// service to source the paying invoice. "native" performs a fully
+	// offline self-payment routed out one channel and back in via
+	// ReceiveThroughNodePubkey, without trusting a third-party order
+	// server.
+	Mode string `json:"mode,omitempty"`
+
+	// OutgoingChannelId, if set, pins the outbound leg of the rebalance to
+	// this specific channel rather than letting the router pick one.
+	OutgoingChannelId string `json:"outgoingChannelId,omitempty"`
+	// OutgoingPeerPubkey is an alternative to OutgoingChannelId when the
+	// caller only knows which peer to drain, not the channel ID.
+	OutgoingPeerPubkey string `json:"outgoingPeerPubkey,omitempty"`
+
+	// MaxFeeSat caps the total fee we're willing to pay for the rebalance,
+	// in satoshis. A zero value means no local cap is enforced.
+	MaxFeeSat uint64 `json:"maxFeeSat,omitempty"`
+	// MaxFeePpm caps the fee as parts-per-million of AmountSat. If both
+	// MaxFeeSat and MaxFeePpm are set, the lower of the two limits applies.
+	MaxFeePpm uint64 `json:"maxFeePpm,omitempty"`
+	// CltvLimit caps the total route CLTV delta we're willing to lock funds
+	// for. A zero value means no local cap is enforced.
+	CltvLimit uint32 `json:"cltvLimit,omitempty"`
+	// TimeoutSeconds bounds how long we wait for the payment to resolve
+	// before giving up. A zero value falls back to the service default.
+	TimeoutSeconds uint32 `json:"timeoutSeconds,omitempty"`
+
+	// Probe, when set, makes RebalanceChannel only probe the route to the
+	// receive_through node and return the probe result, without ever
+	// creating a rebalance order or spending any fees.
+	Probe bool `json:"probe,omitempty"`
+	// RequireProbe, when set (and Probe is false), makes RebalanceChannel
+	// probe the route before creating the order and abort early if the
+	// route isn't reachable.
+	RequireProbe bool `json:"requireProbe,omitempty"`
+
+	// MaxParts splits the rebalance into up to this many MPP shards when
+	// a single path can't carry the full amount. The default of 1 (or 0)
+	// keeps the existing single-path behaviour.
+	MaxParts uint32 `json:"maxParts,omitempty"`
+	// MinPartSat is the smallest shard size MaxParts splitting is allowed
+	// to produce.
+	MinPartSat uint64 `json:"minPartSat,omitempty"`
+}
+
+// RebalanceChannelResponse reports the outcome of a RebalanceChannel call.
+type RebalanceChannelResponse struct {
+	TotalFeeSat uint64 `json:"totalFeeSat"`
+
+	// Probe is populated instead of TotalFeeSat when the request had
+	// Probe set: no payment was made, only the route was checked.
+	Probe *ProbeResult `json:"probe,omitempty"`
+
+	// Shards is populated instead of a single payment result when the
+	// request had MaxParts > 1: one entry per MPP shard dispatched.
+	Shards []ShardResult `json:"shards,omitempty"`
+}
@@ -0,0 +1,81 @@
+package api
+
+// ShardResult reports the outcome of one MPP shard of a rebalance payment.
+type ShardResult struct {
+	AmountSat     uint64 `json:"amountSat"`
+	FeeSat        uint64 `json:"feeSat"`
+	Success       bool   `json:"success"`
+	FailureReason string `json:"failureReason,omitempty"`
+}
+
+// ProbeResult reports the outcome of a route probe: whether the destination
+// was reachable with liquidity for the requested amount, and if not, where
+// and why it failed.
+type ProbeResult struct {
+	Reachable     bool   `json:"reachable"`
+	FeeMsat       uint64 `json:"feeMsat"`
+	FailureSource string `json:"failureSource,omitempty"`
+	FailureCode   string `json:"failureCode,omitempty"`
+}
+
+// PayInvoiceResponse reports the outcome of a bolt11 payment dispatched via
+// TransactionsService.
+type PayInvoiceResponse struct {
+	Preimage string
+	FeeMsat  uint64
+}
+
+// PaymentConstraints bounds how a payment may be routed: which channel it
+// must leave through, how much fee and CLTV it may spend, and how long to
+// wait before giving up.
+type PaymentConstraints struct {
+	OutgoingChannelId  string
+	OutgoingPeerPubkey string
+	MaxFeeMsat         uint64
+	CltvLimit          uint32
+	TimeoutSeconds     uint32
+}
+
+// paymentConstraints builds the PaymentConstraints implied by the request, or
+// nil if the caller didn't ask for any routing constraints.
+func (r *RebalanceChannelRequest) paymentConstraints() *PaymentConstraints {
+	if r.OutgoingChannelId == "" && r.OutgoingPeerPubkey == "" && r.MaxFeeSat == 0 && r.MaxFeePpm == 0 && r.CltvLimit == 0 && r.TimeoutSeconds == 0 {
+		return nil
+	}
+	return &PaymentConstraints{
+		OutgoingChannelId:  r.OutgoingChannelId,
+		OutgoingPeerPubkey: r.OutgoingPeerPubkey,
+		MaxFeeMsat:         r.maxFeeSat() * 1000,
+		CltvLimit:          r.CltvLimit,
+		TimeoutSeconds:     r.TimeoutSeconds,
+	}
+}
+
+// maxFeeSat resolves the effective fee cap for the request, taking the lower
+// of MaxFeeSat and MaxFeePpm (applied against AmountSat) when both are set.
+// It returns 0 if no cap applies.
+func (r *RebalanceChannelRequest) maxFeeSat() uint64 {
+	cap := r.MaxFeeSat
+	if r.MaxFeePpm > 0 {
+		ppmCap := r.AmountSat * r.MaxFeePpm / 1_000_000
+		if cap == 0 || ppmCap < cap {
+			cap = ppmCap
+		}
+	}
+	return cap
+}
+
+// PaymentUpdate is one lifecycle event of an in-flight payment, forwarded
+// from the LNClient backend (e.g. LDK's Event::PaymentPathSuccessful /
+// PaymentPathFailed) through TransactionsService.SendPaymentAsync.
+type PaymentUpdate struct {
+	Event   string `json:"event"`
+	FeeMsat uint64 `json:"feeMsat,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// usesMPP reports whether the request asked for the amount to be split
+// across more than one shard.
+func (r *RebalanceChannelRequest) usesMPP() bool {
+	return r.MaxParts > 1
+}
@@ -0,0 +1,95 @@
+package api
+
+import "testing"
+
+func TestRebalanceChannelRequest_maxFeeSat(t *testing.T) {
+	tests := []struct {
+		name string
+		req  RebalanceChannelRequest
+		want uint64
+	}{
+		{
+			name: "neither set",
+			req:  RebalanceChannelRequest{AmountSat: 100_000},
+			want: 0,
+		},
+		{
+			name: "only MaxFeeSat set",
+			req:  RebalanceChannelRequest{AmountSat: 100_000, MaxFeeSat: 500},
+			want: 500,
+		},
+		{
+			name: "only MaxFeePpm set",
+			req:  RebalanceChannelRequest{AmountSat: 100_000, MaxFeePpm: 1_000},
+			want: 100,
+		},
+		{
+			name: "both set, ppm cap lower wins",
+			req:  RebalanceChannelRequest{AmountSat: 100_000, MaxFeeSat: 1_000, MaxFeePpm: 1_000},
+			want: 100,
+		},
+		{
+			name: "both set, flat cap lower wins",
+			req:  RebalanceChannelRequest{AmountSat: 100_000, MaxFeeSat: 50, MaxFeePpm: 1_000},
+			want: 50,
+		},
+		{
+			name: "both set, equal caps",
+			req:  RebalanceChannelRequest{AmountSat: 100_000, MaxFeeSat: 100, MaxFeePpm: 1_000},
+			want: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.maxFeeSat(); got != tt.want {
+				t.Errorf("maxFeeSat() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRebalanceChannelRequest_paymentConstraints(t *testing.T) {
+	t.Run("nil when no constraint fields set", func(t *testing.T) {
+		req := RebalanceChannelRequest{AmountSat: 100_000}
+		if got := req.paymentConstraints(); got != nil {
+			t.Errorf("paymentConstraints() = %+v, want nil", got)
+		}
+	})
+
+	tests := []struct {
+		name string
+		req  RebalanceChannelRequest
+	}{
+		{name: "OutgoingChannelId set", req: RebalanceChannelRequest{OutgoingChannelId: "123x456x0"}},
+		{name: "OutgoingPeerPubkey set", req: RebalanceChannelRequest{OutgoingPeerPubkey: "02abc"}},
+		{name: "MaxFeeSat set", req: RebalanceChannelRequest{MaxFeeSat: 10}},
+		{name: "MaxFeePpm set", req: RebalanceChannelRequest{AmountSat: 1_000, MaxFeePpm: 100}},
+		{name: "CltvLimit set", req: RebalanceChannelRequest{CltvLimit: 144}},
+		{name: "TimeoutSeconds set", req: RebalanceChannelRequest{TimeoutSeconds: 30}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.req.paymentConstraints()
+			if got == nil {
+				t.Fatalf("paymentConstraints() = nil, want non-nil")
+			}
+			if got.OutgoingChannelId != tt.req.OutgoingChannelId {
+				t.Errorf("OutgoingChannelId = %q, want %q", got.OutgoingChannelId, tt.req.OutgoingChannelId)
+			}
+			if got.OutgoingPeerPubkey != tt.req.OutgoingPeerPubkey {
+				t.Errorf("OutgoingPeerPubkey = %q, want %q", got.OutgoingPeerPubkey, tt.req.OutgoingPeerPubkey)
+			}
+			if got.MaxFeeMsat != tt.req.maxFeeSat()*1000 {
+				t.Errorf("MaxFeeMsat = %d, want %d", got.MaxFeeMsat, tt.req.maxFeeSat()*1000)
+			}
+			if got.CltvLimit != tt.req.CltvLimit {
+				t.Errorf("CltvLimit = %d, want %d", got.CltvLimit, tt.req.CltvLimit)
+			}
+			if got.TimeoutSeconds != tt.req.TimeoutSeconds {
+				t.Errorf("TimeoutSeconds = %d, want %d", got.TimeoutSeconds, tt.req.TimeoutSeconds)
+			}
+		})
+	}
+}
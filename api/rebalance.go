@@ -1,26 +1,48 @@
 package api
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
-	"time"
 
+	"github.com/getAlby/hub/lnclient"
 	"github.com/getAlby/hub/logger"
 	decodepay "github.com/nbd-wtf/ln-decodepay"
 	"github.com/sirupsen/logrus"
 )
 
+// constrainedSender is an optional TransactionsService capability for
+// dispatching a synchronous payment with routing constraints (outgoing
+// channel/peer, fee/CLTV caps, timeout) applied. Backends that haven't added
+// it yet simply don't implement it, and a constrained rebalance falls back
+// to a clear error instead of silently ignoring the constraints. Its result
+// is a standalone PayInvoiceResponse rather than whatever SendPaymentSync
+// returns: the two aren't required to share a return type, so each branch
+// below reads its own response independently.
+type constrainedSender interface {
+	SendPaymentSyncWithConstraints(ctx context.Context, payReq string, amount *uint64, metadata map[string]interface{}, lnClient lnclient.LNClient, appId *uint, requestEventId *uint, swapId *uint, constraints *PaymentConstraints) (*PayInvoiceResponse, error)
+}
+
 func (api *api) RebalanceChannel(ctx context.Context, rebalanceChannelRequest *RebalanceChannelRequest) (*RebalanceChannelResponse, error) {
 	if api.svc.GetLNClient() == nil {
 		return nil, errors.New("LNClient not started")
 	}
 
+	if rebalanceChannelRequest.Probe {
+		return api.buildProbeResponse(ctx, rebalanceChannelRequest)
+	}
+
+	if rebalanceChannelRequest.RequireProbe {
+		if err := api.requireReachableProbe(ctx, rebalanceChannelRequest); err != nil {
+			return nil, fmt.Errorf("rebalance route probe failed: %w", err)
+		}
+	}
+
+	if rebalanceChannelRequest.Mode == "native" {
+		return api.rebalanceChannelNative(ctx, rebalanceChannelRequest)
+	}
+
 	// Validate that the receive_through node is actually a channel peer
 	channels, err := api.svc.GetLNClient().ListChannels(ctx)
 	if err != nil {
@@ -80,94 +102,12 @@ func (api *api) RebalanceChannel(ctx context.Context, rebalanceChannelRequest *R
 		"channels":       channelSummary,
 	}).Info("Available channels for routing diagnostics")
 
-	receiveMetadata := map[string]interface{}{
-		"receive_through": rebalanceChannelRequest.ReceiveThroughNodePubkey,
-		"amount_sat":      rebalanceChannelRequest.AmountSat,
-	}
-
-	receiveInvoice, err := api.svc.GetTransactionsService().MakeInvoice(ctx, rebalanceChannelRequest.AmountSat*1000, "Alby Hub Rebalance through "+rebalanceChannelRequest.ReceiveThroughNodePubkey, "", 0, receiveMetadata, api.svc.GetLNClient(), nil, nil)
+	bolt11, orderId, err := api.createRebalanceOrder(ctx, rebalanceChannelRequest)
 	if err != nil {
-		logger.Logger.WithError(err).Error("failed to generate rebalance receive invoice")
+		// createRebalanceOrder already logs the specific failure point.
 		return nil, err
 	}
 
-	type rspCreateOrderRequest struct {
-		Token                   string `json:"token"`
-		PayRequest              string `json:"pay_request"`
-		PayThroughThisPublicKey string `json:"pay_through_this_public_key"`
-	}
-
-	newRspCreateOrderRequest := rspCreateOrderRequest{
-		Token:                   "alby-hub",
-		PayRequest:              receiveInvoice.PaymentRequest,
-		PayThroughThisPublicKey: rebalanceChannelRequest.ReceiveThroughNodePubkey,
-	}
-
-	payloadBytes, err := json.Marshal(newRspCreateOrderRequest)
-	if err != nil {
-		return nil, err
-	}
-	bodyReader := bytes.NewReader(payloadBytes)
-
-	req, err := http.NewRequest(http.MethodPost, api.cfg.GetEnv().RebalanceServiceUrl+"/api/rebalance/v1/create_order", bodyReader)
-	if err != nil {
-		logger.Logger.WithError(err).WithFields(logrus.Fields{
-			"request": newRspCreateOrderRequest,
-		}).Error("Failed to create new rebalance request")
-		return nil, err
-	}
-
-	setDefaultRequestHeaders(req)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := http.Client{
-		Timeout: time.Second * 60,
-	}
-
-	res, err := client.Do(req)
-	if err != nil {
-		logger.Logger.WithError(err).WithFields(logrus.Fields{
-			"request": newRspCreateOrderRequest,
-		}).Error("Failed to request new rebalance order")
-		return nil, err
-	}
-
-	defer res.Body.Close()
-
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		logger.Logger.WithError(err).WithFields(logrus.Fields{
-			"request": newRspCreateOrderRequest,
-		}).Error("Failed to read response body")
-		return nil, errors.New("failed to read response body")
-	}
-
-	if res.StatusCode >= 300 {
-		logger.Logger.WithFields(logrus.Fields{
-			"request":    newRspCreateOrderRequest,
-			"body":       string(body),
-			"statusCode": res.StatusCode,
-		}).Error("rebalance create_order endpoint returned non-success code")
-		return nil, fmt.Errorf("rebalance create_order endpoint returned non-success code: %s", string(body))
-	}
-
-	type rspRebalanceCreateOrderResponse struct {
-		OrderId    string `json:"order_id"`
-		PayRequest string `json:"pay_request"`
-	}
-
-	var rebalanceCreateOrderResponse rspRebalanceCreateOrderResponse
-
-	err = json.Unmarshal(body, &rebalanceCreateOrderResponse)
-	if err != nil {
-		logger.Logger.WithError(err).WithFields(logrus.Fields{
-			"request": newRspCreateOrderRequest,
-		}).Error("Failed to deserialize json")
-		return nil, fmt.Errorf("failed to deserialize json from rebalance create order response: %s", string(body))
-	}
-
-	logger.Logger.WithField("response", rebalanceCreateOrderResponse).Info("New rebalance order created")
-
 	// Log additional context for debugging routing issues
 	nodeInfo, err := api.svc.GetLNClient().GetNodeConnectionInfo(ctx)
 	if err == nil {
@@ -177,7 +117,7 @@ func (api *api) RebalanceChannel(ctx context.Context, rebalanceChannelRequest *R
 		}).Info("Node information for rebalance routing")
 	}
 
-	paymentRequest, err := decodepay.Decodepay(rebalanceCreateOrderResponse.PayRequest)
+	paymentRequest, err := decodepay.Decodepay(bolt11)
 	if err != nil {
 		logger.Logger.WithError(err).Error("Failed to decode bolt11 invoice")
 		return nil, err
@@ -186,13 +126,13 @@ func (api *api) RebalanceChannel(ctx context.Context, rebalanceChannelRequest *R
 	payMetadata := map[string]interface{}{
 		"receive_through": rebalanceChannelRequest.ReceiveThroughNodePubkey,
 		"amount_sat":      rebalanceChannelRequest.AmountSat,
-		"order_id":        rebalanceCreateOrderResponse.OrderId,
+		"order_id":        orderId,
 	}
 
 	logger.Logger.WithFields(logrus.Fields{
 		"receive_through_pubkey": rebalanceChannelRequest.ReceiveThroughNodePubkey,
 		"amount_sat":             rebalanceChannelRequest.AmountSat,
-		"order_id":               rebalanceCreateOrderResponse.OrderId,
+		"order_id":               orderId,
 		"payment_hash":           paymentRequest.PaymentHash,
 		"destination":            paymentRequest.Payee,
 		"amount_msat":            paymentRequest.MSatoshi,
@@ -200,17 +140,45 @@ func (api *api) RebalanceChannel(ctx context.Context, rebalanceChannelRequest *R
 		"expiry":                 paymentRequest.Expiry,
 	}).Info("Attempting to pay rebalance invoice")
 
-	payRebalanceInvoiceResponse, err := api.svc.GetTransactionsService().SendPaymentSync(ctx, rebalanceCreateOrderResponse.PayRequest, nil, payMetadata, api.svc.GetLNClient(), nil, nil, nil)
+	if rebalanceChannelRequest.usesMPP() {
+		return api.sendRebalanceMPP(ctx, rebalanceChannelRequest, bolt11, payMetadata)
+	}
+
+	constraints := rebalanceChannelRequest.paymentConstraints()
+
+	// The two branches deliberately don't share a response variable: a
+	// constrained send is a distinct, optional capability with its own
+	// response type, not a drop-in replacement for the existing
+	// SendPaymentSync call. Each branch extracts the one field
+	// (fee) the caller needs into feeMsat instead.
+	var feeMsat uint64
+	if constraints != nil {
+		sender, ok := api.svc.GetTransactionsService().(constrainedSender)
+		if !ok {
+			return nil, errors.New("TransactionsService does not support constrained rebalance payments")
+		}
+		var payRebalanceInvoiceResponse *PayInvoiceResponse
+		payRebalanceInvoiceResponse, err = sender.SendPaymentSyncWithConstraints(ctx, bolt11, nil, payMetadata, api.svc.GetLNClient(), nil, nil, nil, constraints)
+		if err == nil {
+			feeMsat = payRebalanceInvoiceResponse.FeeMsat
+		}
+	} else {
+		payRebalanceInvoiceResponse, sendErr := api.svc.GetTransactionsService().SendPaymentSync(ctx, bolt11, nil, payMetadata, api.svc.GetLNClient(), nil, nil, nil)
+		err = sendErr
+		if err == nil {
+			feeMsat = payRebalanceInvoiceResponse.FeeMsat
+		}
+	}
 
 	if err != nil {
 		logger.Logger.WithFields(logrus.Fields{
 			"receive_through_pubkey": rebalanceChannelRequest.ReceiveThroughNodePubkey,
 			"amount_sat":             rebalanceChannelRequest.AmountSat,
-			"order_id":               rebalanceCreateOrderResponse.OrderId,
+			"order_id":               orderId,
 			"payment_hash":           paymentRequest.PaymentHash,
 			"destination":            paymentRequest.Payee,
 			"amount_msat":            paymentRequest.MSatoshi,
-			"bolt11":                 rebalanceCreateOrderResponse.PayRequest,
+			"bolt11":                 bolt11,
 		}).WithError(err).Error("Failed to pay rebalance invoice - check if routing path exists through specified node")
 
 		// Provide more specific error guidance
@@ -230,6 +198,6 @@ func (api *api) RebalanceChannel(ctx context.Context, rebalanceChannelRequest *R
 	}
 
 	return &RebalanceChannelResponse{
-		TotalFeeSat: uint64(paymentRequest.MSatoshi)/1000 + payRebalanceInvoiceResponse.FeeMsat/1000 - rebalanceChannelRequest.AmountSat,
+		TotalFeeSat: uint64(paymentRequest.MSatoshi)/1000 + feeMsat/1000 - rebalanceChannelRequest.AmountSat,
 	}, nil
 }
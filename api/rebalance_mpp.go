@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// mppInvoiceMaker is an optional TransactionsService capability for
+// generating a receive invoice that actually advertises MPP/AMP support
+// (a shared payment_addr a sender can consolidate shards against), rather
+// than a plain single-HTLC invoice with "mpp" only noted in metadata. It
+// does not exist on the real TransactionsService yet; until it's added,
+// createRebalanceOrder's MPP branch always fails with the "does not
+// support MPP-capable receive invoices" error.
+type mppInvoiceMaker interface {
+	MakeMPPInvoice(ctx context.Context, amountMsat uint64, description string, expiry int64, metadata map[string]interface{}, lnClient lnclient.LNClient, appId *uint, requestEventId *uint) (*MPPInvoice, error)
+}
+
+// MPPInvoice is the subset of an MPP-capable receive invoice's fields that
+// rebalance order creation needs.
+type MPPInvoice struct {
+	PaymentRequest string
+}
+
+// mppSender is an optional TransactionsService-style capability for
+// splitting a payment into shards that are tried in parallel against a
+// shared payment_addr, aggregating fee and success per shard. Large
+// rebalances that can't fit down a single path use it instead of
+// SendPaymentSync. Like mppInvoiceMaker, it does not exist on the real
+// TransactionsService yet, so sendRebalanceMPP always fails with the
+// "does not support MPP rebalancing" error until it's added.
+type mppSender interface {
+	SendPaymentMPP(ctx context.Context, bolt11 string, maxParts uint32, minPartSat uint64, metadata map[string]interface{}, lnClient lnclient.LNClient) ([]ShardResult, error)
+}
+
+// sendRebalanceMPP dispatches the rebalance payment as multiple parallel
+// shards and aggregates the result.
+func (api *api) sendRebalanceMPP(ctx context.Context, rebalanceChannelRequest *RebalanceChannelRequest, bolt11 string, payMetadata map[string]interface{}) (*RebalanceChannelResponse, error) {
+	sender, ok := api.svc.GetTransactionsService().(mppSender)
+	if !ok {
+		return nil, errors.New("TransactionsService does not support MPP rebalancing")
+	}
+
+	shards, err := sender.SendPaymentMPP(ctx, bolt11, rebalanceChannelRequest.MaxParts, rebalanceChannelRequest.MinPartSat, payMetadata, api.svc.GetLNClient())
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to send MPP rebalance payment")
+		return nil, err
+	}
+
+	response, failed, err := aggregateShardResults(shards)
+
+	var totalFeeSat uint64
+	if response != nil {
+		totalFeeSat = response.TotalFeeSat
+	}
+	logger.Logger.WithFields(logrus.Fields{
+		"receive_through_pubkey": rebalanceChannelRequest.ReceiveThroughNodePubkey,
+		"amount_sat":             rebalanceChannelRequest.AmountSat,
+		"max_parts":              rebalanceChannelRequest.MaxParts,
+		"shards":                 len(shards),
+		"failed_shards":          failed,
+		"total_fee_sat":          totalFeeSat,
+	}).Info("Completed MPP rebalance payment")
+
+	return response, err
+}
+
+// aggregateShardResults sums the fees of successful shards and reports the
+// failed shard count, failing the rebalance only when every shard failed:
+// a partial failure still moved the full amount (the sender already retries
+// failed shards down alternate paths), so it's success from the caller's
+// point of view.
+func aggregateShardResults(shards []ShardResult) (*RebalanceChannelResponse, int, error) {
+	var totalFeeSat uint64
+	var failed int
+	for _, shard := range shards {
+		if shard.Success {
+			totalFeeSat += shard.FeeSat
+		} else {
+			failed++
+		}
+	}
+
+	if failed == len(shards) {
+		return nil, failed, errors.New("all MPP rebalance shards failed")
+	}
+
+	return &RebalanceChannelResponse{
+		TotalFeeSat: totalFeeSat,
+		Shards:      shards,
+	}, failed, nil
+}
@@ -0,0 +1,59 @@
+package api
+
+import "testing"
+
+func TestAggregateShardResults(t *testing.T) {
+	t.Run("all shards succeed", func(t *testing.T) {
+		shards := []ShardResult{
+			{AmountSat: 1_000, FeeSat: 1, Success: true},
+			{AmountSat: 2_000, FeeSat: 3, Success: true},
+		}
+		response, failed, err := aggregateShardResults(shards)
+		if err != nil {
+			t.Fatalf("aggregateShardResults() error = %v", err)
+		}
+		if failed != 0 {
+			t.Errorf("failed = %d, want 0", failed)
+		}
+		if response.TotalFeeSat != 4 {
+			t.Errorf("TotalFeeSat = %d, want 4", response.TotalFeeSat)
+		}
+		if len(response.Shards) != 2 {
+			t.Errorf("len(Shards) = %d, want 2", len(response.Shards))
+		}
+	})
+
+	t.Run("partial failure still succeeds", func(t *testing.T) {
+		shards := []ShardResult{
+			{AmountSat: 1_000, FeeSat: 1, Success: true},
+			{AmountSat: 2_000, Success: false, FailureReason: "temporary channel failure"},
+		}
+		response, failed, err := aggregateShardResults(shards)
+		if err != nil {
+			t.Fatalf("aggregateShardResults() error = %v", err)
+		}
+		if failed != 1 {
+			t.Errorf("failed = %d, want 1", failed)
+		}
+		if response.TotalFeeSat != 1 {
+			t.Errorf("TotalFeeSat = %d, want 1 (failed shard's fee must not be counted)", response.TotalFeeSat)
+		}
+	})
+
+	t.Run("all shards fail", func(t *testing.T) {
+		shards := []ShardResult{
+			{AmountSat: 1_000, Success: false, FailureReason: "no_route"},
+			{AmountSat: 2_000, Success: false, FailureReason: "no_route"},
+		}
+		response, failed, err := aggregateShardResults(shards)
+		if err == nil {
+			t.Fatal("aggregateShardResults() error = nil, want error when every shard fails")
+		}
+		if response != nil {
+			t.Errorf("response = %+v, want nil", response)
+		}
+		if failed != len(shards) {
+			t.Errorf("failed = %d, want %d", failed, len(shards))
+		}
+	})
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// routeBuilder is an optional LNClient capability for assembling a route
+// that leaves through outgoingChannelId and then follows an ordered list of
+// hop pubkeys, with per-hop fee/CLTV computed from
+// the channel graph. It does not exist on lnclient.LNClient or any backend
+// (LND/LDK/phoenixd/cashu) yet; until one of them implements it, native
+// rebalancing always falls back to the "no route builder" error below.
+// Adding it is a prerequisite for this feature to actually run anywhere.
+type routeBuilder interface {
+	BuildRoute(ctx context.Context, outgoingChannelId string, hopPubkeys []string, amountMsat uint64, finalCltvDelta uint32) (*Route, error)
+}
+
+// routeSender is an optional LNClient capability for dispatching a payment
+// along a pre-built route rather than letting the backend's own pathfinding
+// choose one. Like routeBuilder, no backend implements this yet.
+type routeSender interface {
+	SendToRoute(ctx context.Context, route *Route, paymentHash string) (*SendToRouteResponse, error)
+}
+
+// holdInvoiceReceiver is an optional LNClient capability for registering a
+// payment hash as a pending (hodl-invoice-like) receive on our own node
+// before a native self-payment loops back to us, and settling it with the
+// preimage once the HTLC arrives. Without this, our node has no record of
+// the hash and can never resolve the incoming HTLC. No backend implements
+// this yet either.
+type holdInvoiceReceiver interface {
+	AddHoldInvoice(ctx context.Context, paymentHash string, amountMsat uint64) error
+	SettleHoldInvoice(ctx context.Context, preimage string) error
+}
+
+// routeProber is an optional LNClient capability for pre-flight checking
+// whether a route is reachable and has liquidity for an amount, without
+// actually moving funds. It's implemented by sending a payment addressed
+// with a random payment hash that no node holds the preimage for: an
+// IncorrectPaymentDetails/UnknownPaymentHash failure at the final hop means
+// the route and liquidity are good, while any earlier failure is a real
+// routing problem. It does not exist on lnclient.LNClient or any backend
+// yet; until one implements it, Probe/RequireProbe always fail with the
+// "does not support route probing" error in probeRebalanceRoute.
+type routeProber interface {
+	ProbeRoute(ctx context.Context, invoice string, amountMsat uint64, constraints *PaymentConstraints) (*ProbeResult, error)
+}
+
+// Route is a fully assembled payment path, hop by hop, ready to hand to
+// SendToRoute.
+type Route struct {
+	TotalAmountMsat uint64
+	TotalFeeMsat    uint64
+	TotalCltvDelta  uint32
+	Hops            []RouteHop
+}
+
+// RouteHop is a single hop of a Route.
+type RouteHop struct {
+	ChannelId  string
+	PubKey     string
+	AmountMsat uint64
+	FeeMsat    uint64
+	CltvExpiry uint32
+}
+
+// SendToRouteResponse reports the outcome of dispatching a payment along a
+// pre-built route.
+type SendToRouteResponse struct {
+	Preimage string
+	FeeMsat  uint64
+}
+
+// defaultFinalCltvDelta is the final-hop CLTV delta handed to BuildRoute for
+// every native rebalance; CltvLimit does not change it. It's distinct from
+// CltvLimit, which caps the route's *total* CLTV delta after the route is
+// built.
+const defaultFinalCltvDelta = 40
+
+// selectOutgoingChannel resolves the outbound leg of a native rebalance:
+// the channel pinned by OutgoingChannelId/OutgoingPeerPubkey if the caller
+// set one, or the first active channel with enough spendable balance
+// otherwise (never the channel to the receive-through peer itself, since
+// that would make the "loop" a no-op). Whether pinned or auto-selected,
+// the channel must actually be usable: an explicitly pinned but inactive
+// or under-funded channel fails with the same clear error instead of an
+// opaque backend error from BuildRoute/SendToRoute.
+func selectOutgoingChannel(channels []lnclient.Channel, rebalanceChannelRequest *RebalanceChannelRequest, requiredSpendableMsat int64) (*lnclient.Channel, error) {
+	var outgoingChannel *lnclient.Channel
+	switch {
+	case rebalanceChannelRequest.OutgoingChannelId != "":
+		for i, channel := range channels {
+			if channel.ChannelId == rebalanceChannelRequest.OutgoingChannelId {
+				outgoingChannel = &channels[i]
+				break
+			}
+		}
+		if outgoingChannel == nil {
+			return nil, fmt.Errorf("no channel found with id %s", rebalanceChannelRequest.OutgoingChannelId)
+		}
+	case rebalanceChannelRequest.OutgoingPeerPubkey != "":
+		for i, channel := range channels {
+			if channel.RemotePubkey == rebalanceChannelRequest.OutgoingPeerPubkey {
+				outgoingChannel = &channels[i]
+				break
+			}
+		}
+		if outgoingChannel == nil {
+			return nil, fmt.Errorf("no channel found with peer %s", rebalanceChannelRequest.OutgoingPeerPubkey)
+		}
+	default:
+		for i, channel := range channels {
+			if channel.RemotePubkey == rebalanceChannelRequest.ReceiveThroughNodePubkey {
+				continue
+			}
+			if channel.Active && channel.LocalSpendableBalance >= requiredSpendableMsat {
+				outgoingChannel = &channels[i]
+				break
+			}
+		}
+	}
+	if outgoingChannel == nil || !outgoingChannel.Active || outgoingChannel.LocalSpendableBalance < requiredSpendableMsat {
+		return nil, errors.New("no outbound channel with sufficient spendable balance for native rebalance")
+	}
+	return outgoingChannel, nil
+}
+
+// rebalanceChannelNative performs a true self-payment loop the way lnd does
+// it: we generate the payment hash ourselves, route a payment out one of our
+// channels and back in through the specified peer, and settle it against
+// ourselves. Unlike the default order-service flow, this never leaves our
+// node and needs no third party to mint the invoice.
+func (api *api) rebalanceChannelNative(ctx context.Context, rebalanceChannelRequest *RebalanceChannelRequest) (*RebalanceChannelResponse, error) {
+	lnClient := api.svc.GetLNClient()
+
+	builder, ok := lnClient.(routeBuilder)
+	if !ok {
+		return nil, errors.New("LNClient backend does not support native rebalancing (no route builder)")
+	}
+	sender, ok := lnClient.(routeSender)
+	if !ok {
+		return nil, errors.New("LNClient backend does not support native rebalancing (no route sender)")
+	}
+	receiver, ok := lnClient.(holdInvoiceReceiver)
+	if !ok {
+		return nil, errors.New("LNClient backend does not support native rebalancing (no hold invoice receiver)")
+	}
+
+	channels, err := lnClient.ListChannels(ctx)
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to list channels for native rebalance")
+		return nil, fmt.Errorf("failed to list channels: %w", err)
+	}
+
+	requiredSpendableMsat := int64(rebalanceChannelRequest.AmountSat * 1000)
+
+	outgoingChannel, err := selectOutgoingChannel(channels, rebalanceChannelRequest, requiredSpendableMsat)
+	if err != nil {
+		return nil, err
+	}
+	outgoingPeer := outgoingChannel.RemotePubkey
+
+	preimage := make([]byte, 32)
+	if _, err := rand.Read(preimage); err != nil {
+		return nil, fmt.Errorf("failed to generate preimage: %w", err)
+	}
+	paymentHashBytes := sha256.Sum256(preimage)
+	paymentHash := fmt.Sprintf("%x", paymentHashBytes)
+	preimageHex := fmt.Sprintf("%x", preimage)
+
+	amountMsat := rebalanceChannelRequest.AmountSat * 1000
+
+	nodeInfo, err := lnClient.GetNodeConnectionInfo(ctx)
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to get our own node pubkey for native rebalance")
+		return nil, fmt.Errorf("failed to get our own node pubkey: %w", err)
+	}
+
+	route, err := builder.BuildRoute(ctx, outgoingChannel.ChannelId, []string{outgoingPeer, rebalanceChannelRequest.ReceiveThroughNodePubkey, nodeInfo.Pubkey}, amountMsat, defaultFinalCltvDelta)
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to build native rebalance route")
+		return nil, fmt.Errorf("failed to build route: %w", err)
+	}
+
+	if maxFeeSat := rebalanceChannelRequest.maxFeeSat(); maxFeeSat > 0 && route.TotalFeeMsat/1000 > maxFeeSat {
+		return nil, fmt.Errorf("native rebalance route fee %d sat exceeds max fee %d sat", route.TotalFeeMsat/1000, maxFeeSat)
+	}
+	if rebalanceChannelRequest.CltvLimit > 0 && route.TotalCltvDelta > rebalanceChannelRequest.CltvLimit {
+		return nil, fmt.Errorf("native rebalance route cltv delta %d exceeds cltv limit %d", route.TotalCltvDelta, rebalanceChannelRequest.CltvLimit)
+	}
+
+	if err := receiver.AddHoldInvoice(ctx, paymentHash, amountMsat); err != nil {
+		logger.Logger.WithError(err).Error("Failed to register native rebalance hold invoice")
+		return nil, fmt.Errorf("failed to register hold invoice: %w", err)
+	}
+
+	logger.Logger.WithFields(logrus.Fields{
+		"outgoing_peer":          outgoingPeer,
+		"receive_through_pubkey": rebalanceChannelRequest.ReceiveThroughNodePubkey,
+		"our_pubkey":             nodeInfo.Pubkey,
+		"amount_msat":            amountMsat,
+		"route_total_fee_msat":   route.TotalFeeMsat,
+		"route_total_cltv_delta": route.TotalCltvDelta,
+		"payment_hash":           paymentHash,
+	}).Info("Dispatching native circular rebalance")
+
+	sendResponse, err := sender.SendToRoute(ctx, route, paymentHash)
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to send native rebalance payment")
+		return nil, fmt.Errorf("failed to send payment along route: %w", err)
+	}
+
+	if err := receiver.SettleHoldInvoice(ctx, preimageHex); err != nil {
+		logger.Logger.WithError(err).Error("Failed to settle native rebalance hold invoice")
+		return nil, fmt.Errorf("failed to settle hold invoice: %w", err)
+	}
+
+	return &RebalanceChannelResponse{
+		TotalFeeSat: sendResponse.FeeMsat / 1000,
+	}, nil
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/getAlby/hub/lnclient"
+)
+
+func TestSelectOutgoingChannel(t *testing.T) {
+	channels := []lnclient.Channel{
+		{ChannelId: "1x1x0", RemotePubkey: "receive-through", Active: true, LocalSpendableBalance: 1_000_000},
+		{ChannelId: "2x2x0", RemotePubkey: "peer-a", Active: true, LocalSpendableBalance: 1_000_000},
+		{ChannelId: "3x3x0", RemotePubkey: "peer-b", Active: false, LocalSpendableBalance: 1_000_000},
+		{ChannelId: "4x4x0", RemotePubkey: "peer-c", Active: true, LocalSpendableBalance: 10_000},
+	}
+	const requiredSpendableMsat = 500_000
+
+	t.Run("pinned by channel id", func(t *testing.T) {
+		req := &RebalanceChannelRequest{OutgoingChannelId: "2x2x0", ReceiveThroughNodePubkey: "receive-through"}
+		got, err := selectOutgoingChannel(channels, req, requiredSpendableMsat)
+		if err != nil {
+			t.Fatalf("selectOutgoingChannel() error = %v", err)
+		}
+		if got.ChannelId != "2x2x0" {
+			t.Errorf("ChannelId = %q, want 2x2x0", got.ChannelId)
+		}
+	})
+
+	t.Run("pinned channel id not found", func(t *testing.T) {
+		req := &RebalanceChannelRequest{OutgoingChannelId: "9x9x0", ReceiveThroughNodePubkey: "receive-through"}
+		if _, err := selectOutgoingChannel(channels, req, requiredSpendableMsat); err == nil {
+			t.Error("selectOutgoingChannel() error = nil, want error")
+		}
+	})
+
+	t.Run("pinned but inactive is rejected", func(t *testing.T) {
+		req := &RebalanceChannelRequest{OutgoingChannelId: "3x3x0", ReceiveThroughNodePubkey: "receive-through"}
+		if _, err := selectOutgoingChannel(channels, req, requiredSpendableMsat); err == nil {
+			t.Error("selectOutgoingChannel() error = nil, want error for inactive channel")
+		}
+	})
+
+	t.Run("pinned but under-funded is rejected", func(t *testing.T) {
+		req := &RebalanceChannelRequest{OutgoingChannelId: "4x4x0", ReceiveThroughNodePubkey: "receive-through"}
+		if _, err := selectOutgoingChannel(channels, req, requiredSpendableMsat); err == nil {
+			t.Error("selectOutgoingChannel() error = nil, want error for under-funded channel")
+		}
+	})
+
+	t.Run("pinned by peer pubkey", func(t *testing.T) {
+		req := &RebalanceChannelRequest{OutgoingPeerPubkey: "peer-a", ReceiveThroughNodePubkey: "receive-through"}
+		got, err := selectOutgoingChannel(channels, req, requiredSpendableMsat)
+		if err != nil {
+			t.Fatalf("selectOutgoingChannel() error = %v", err)
+		}
+		if got.RemotePubkey != "peer-a" {
+			t.Errorf("RemotePubkey = %q, want peer-a", got.RemotePubkey)
+		}
+	})
+
+	t.Run("auto-selected skips the receive-through peer", func(t *testing.T) {
+		req := &RebalanceChannelRequest{ReceiveThroughNodePubkey: "peer-a"}
+		got, err := selectOutgoingChannel(channels, req, requiredSpendableMsat)
+		if err != nil {
+			t.Fatalf("selectOutgoingChannel() error = %v", err)
+		}
+		if got.RemotePubkey == "peer-a" {
+			t.Error("selectOutgoingChannel() selected the receive-through peer's own channel")
+		}
+	})
+
+	t.Run("auto-selected skips inactive and under-funded channels", func(t *testing.T) {
+		// Inactive and under-funded channels come first so they must be skipped.
+		ordered := []lnclient.Channel{channels[2], channels[3], channels[0], channels[1]}
+		req := &RebalanceChannelRequest{ReceiveThroughNodePubkey: "receive-through"}
+		got, err := selectOutgoingChannel(ordered, req, requiredSpendableMsat)
+		if err != nil {
+			t.Fatalf("selectOutgoingChannel() error = %v", err)
+		}
+		if got.RemotePubkey != "peer-a" {
+			t.Errorf("RemotePubkey = %q, want peer-a", got.RemotePubkey)
+		}
+	})
+
+	t.Run("no usable channel", func(t *testing.T) {
+		req := &RebalanceChannelRequest{ReceiveThroughNodePubkey: "receive-through"}
+		if _, err := selectOutgoingChannel(nil, req, requiredSpendableMsat); err == nil {
+			t.Error("selectOutgoingChannel() error = nil, want error when no channels are usable")
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/getAlby/hub/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// probeRebalanceRoute generates a self-addressed invoice through the
+// requested receive_through peer and probes it, without ever contacting the
+// rebalance order service. It's used both for an explicit Probe request and
+// to satisfy RequireProbe ahead of the real order.
+func (api *api) probeRebalanceRoute(ctx context.Context, rebalanceChannelRequest *RebalanceChannelRequest) (*ProbeResult, error) {
+	prober, ok := api.svc.GetLNClient().(routeProber)
+	if !ok {
+		return nil, errors.New("LNClient backend does not support route probing")
+	}
+
+	probeMetadata := map[string]interface{}{
+		"receive_through": rebalanceChannelRequest.ReceiveThroughNodePubkey,
+		"amount_sat":      rebalanceChannelRequest.AmountSat,
+		"probe":           true,
+	}
+
+	probeInvoice, err := api.svc.GetTransactionsService().MakeInvoice(ctx, rebalanceChannelRequest.AmountSat*1000, "Alby Hub Rebalance probe through "+rebalanceChannelRequest.ReceiveThroughNodePubkey, "", 0, probeMetadata, api.svc.GetLNClient(), nil, nil)
+	if err != nil {
+		logger.Logger.WithError(err).Error("failed to generate rebalance probe invoice")
+		return nil, err
+	}
+
+	result, err := prober.ProbeRoute(ctx, probeInvoice.PaymentRequest, rebalanceChannelRequest.AmountSat*1000, rebalanceChannelRequest.paymentConstraints())
+	if err != nil {
+		logger.Logger.WithError(err).Error("failed to probe rebalance route")
+		return nil, err
+	}
+
+	logger.Logger.WithFields(logrus.Fields{
+		"receive_through_pubkey": rebalanceChannelRequest.ReceiveThroughNodePubkey,
+		"amount_sat":             rebalanceChannelRequest.AmountSat,
+		"reachable":              result.Reachable,
+		"fee_msat":               result.FeeMsat,
+		"failure_source":         result.FailureSource,
+		"failure_code":           result.FailureCode,
+	}).Info("Probed rebalance route")
+
+	return result, nil
+}
+
+// buildProbeResponse runs probeRebalanceRoute and wraps the result in a
+// RebalanceChannelResponse, for the explicit Probe request path.
+func (api *api) buildProbeResponse(ctx context.Context, rebalanceChannelRequest *RebalanceChannelRequest) (*RebalanceChannelResponse, error) {
+	result, err := api.probeRebalanceRoute(ctx, rebalanceChannelRequest)
+	if err != nil {
+		return nil, err
+	}
+	return &RebalanceChannelResponse{Probe: result}, nil
+}
+
+// requireReachableProbe runs probeRebalanceRoute and turns an unreachable
+// result into a structured error, for use ahead of a real payment.
+func (api *api) requireReachableProbe(ctx context.Context, rebalanceChannelRequest *RebalanceChannelRequest) error {
+	result, err := api.probeRebalanceRoute(ctx, rebalanceChannelRequest)
+	if err != nil {
+		return err
+	}
+	if !result.Reachable {
+		return fmt.Errorf("rebalance route to %s is not reachable (failure_source=%s failure_code=%s)",
+			rebalanceChannelRequest.ReceiveThroughNodePubkey, result.FailureSource, result.FailureCode)
+	}
+	return nil
+}
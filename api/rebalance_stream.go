@@ -0,0 +1,291 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/getAlby/hub/lnclient"
+	"github.com/getAlby/hub/logger"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+	"github.com/sirupsen/logrus"
+)
+
+// asyncSender is an optional TransactionsService capability for dispatching
+// a payment and streaming its lifecycle (HTLC sent, settled, failed) instead
+// of blocking until a single final result, mirroring lnd's bidirectional
+// SendPayment stream. It does not exist on the real TransactionsService yet;
+// until it's added, RebalanceChannelStream always emits a "does not support
+// streaming payments" error.
+type asyncSender interface {
+	SendPaymentAsync(ctx context.Context, bolt11 string, amount *uint64, metadata map[string]interface{}, lnClient lnclient.LNClient, updates chan<- PaymentUpdate) error
+}
+
+// RebalanceChannelStream returns an http.Handler that drives a rebalance for
+// rebalanceChannelRequest and emits its progress as server-sent events:
+// order_created, probe_ok, htlc_sent, htlc_settled, shard_failed and
+// completed. It's the streaming counterpart to RebalanceChannel, for
+// front ends that want live routing feedback instead of a spinner.
+//
+// TODO: register this handler on the router alongside the existing
+// RebalanceChannel endpoint (e.g. POST /api/rebalance/stream) once
+// asyncSender has a real implementation to stream from. It is not wired
+// up anywhere yet, so it's unreachable from any client in the meantime.
+func (api *api) RebalanceChannelStream(rebalanceChannelRequest *RebalanceChannelRequest) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		emit := func(event string, data interface{}) {
+			payload, err := json.Marshal(data)
+			if err != nil {
+				logger.Logger.WithError(err).Error("failed to marshal rebalance stream event")
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+			flusher.Flush()
+		}
+
+		ctx := r.Context()
+
+		if api.svc.GetLNClient() == nil {
+			emit("completed", map[string]string{"error": "LNClient not started"})
+			return
+		}
+
+		if rebalanceChannelRequest.RequireProbe || rebalanceChannelRequest.Probe {
+			result, err := api.probeRebalanceRoute(ctx, rebalanceChannelRequest)
+			if err != nil {
+				emit("completed", map[string]string{"error": err.Error()})
+				return
+			}
+			if result.Reachable {
+				emit("probe_ok", result)
+			}
+			if rebalanceChannelRequest.Probe {
+				emit("completed", result)
+				return
+			}
+			if !result.Reachable {
+				emit("completed", map[string]string{"error": "rebalance route is not reachable"})
+				return
+			}
+		}
+
+		bolt11, orderId, err := api.createRebalanceOrder(ctx, rebalanceChannelRequest)
+		if err != nil {
+			emit("completed", map[string]string{"error": err.Error()})
+			return
+		}
+		emit("order_created", map[string]string{"order_id": orderId})
+
+		sender, ok := api.svc.GetTransactionsService().(asyncSender)
+		if !ok {
+			emit("completed", map[string]string{"error": "TransactionsService does not support streaming payments"})
+			return
+		}
+
+		payMetadata := map[string]interface{}{
+			"receive_through": rebalanceChannelRequest.ReceiveThroughNodePubkey,
+			"amount_sat":      rebalanceChannelRequest.AmountSat,
+			"order_id":        orderId,
+		}
+
+		// Buffered so SendPaymentAsync's goroutine can keep writing updates
+		// (and eventually exit) even after the client has gone away and
+		// we've stopped emitting, rather than blocking on a send forever.
+		updates := make(chan PaymentUpdate, 16)
+		done := make(chan error, 1)
+		go func() {
+			done <- sender.SendPaymentAsync(ctx, bolt11, nil, payMetadata, api.svc.GetLNClient(), updates)
+		}()
+
+		clientGone := false
+		ctxDone := ctx.Done()
+		for {
+			select {
+			case update, ok := <-updates:
+				if !ok {
+					updates = nil
+					continue
+				}
+				if clientGone {
+					continue
+				}
+				switch update.Event {
+				case "sent":
+					emit("htlc_sent", update)
+				case "settled":
+					emit("htlc_settled", update)
+				case "failed":
+					emit("shard_failed", update)
+				default:
+					emit(update.Event, update)
+				}
+			case err := <-done:
+				if clientGone {
+					return
+				}
+				if err != nil {
+					logger.Logger.WithFields(logrus.Fields{
+						"receive_through_pubkey": rebalanceChannelRequest.ReceiveThroughNodePubkey,
+						"order_id":               orderId,
+					}).WithError(err).Error("Streaming rebalance payment failed")
+					emit("completed", map[string]string{"error": err.Error()})
+					return
+				}
+				emit("completed", map[string]string{"order_id": orderId})
+				return
+			case <-ctxDone:
+				// Keep draining updates until SendPaymentAsync actually
+				// finishes (the done case above) instead of returning here,
+				// so its goroutine never blocks trying to send on updates.
+				// Null out ctxDone so this case doesn't immediately fire
+				// again on every loop iteration once ctx is done.
+				clientGone = true
+				ctxDone = nil
+			}
+		}
+	})
+}
+
+// createRebalanceOrder generates our receive invoice and requests a
+// rebalance order from the order service, returning the bolt11 invoice to
+// pay and the order ID. It's shared between RebalanceChannel and
+// RebalanceChannelStream.
+func (api *api) createRebalanceOrder(ctx context.Context, rebalanceChannelRequest *RebalanceChannelRequest) (bolt11 string, orderId string, err error) {
+	receiveMetadata := map[string]interface{}{
+		"receive_through": rebalanceChannelRequest.ReceiveThroughNodePubkey,
+		"amount_sat":      rebalanceChannelRequest.AmountSat,
+	}
+
+	var receivePaymentRequest string
+	if rebalanceChannelRequest.usesMPP() {
+		receiveMetadata["mpp"] = true
+
+		mppMaker, ok := api.svc.GetTransactionsService().(mppInvoiceMaker)
+		if !ok {
+			logger.Logger.Error("TransactionsService does not support MPP-capable receive invoices")
+			return "", "", errors.New("TransactionsService does not support MPP-capable receive invoices")
+		}
+		mppInvoice, err := mppMaker.MakeMPPInvoice(ctx, rebalanceChannelRequest.AmountSat*1000, "Alby Hub Rebalance through "+rebalanceChannelRequest.ReceiveThroughNodePubkey, 0, receiveMetadata, api.svc.GetLNClient(), nil, nil)
+		if err != nil {
+			logger.Logger.WithError(err).Error("failed to generate MPP-capable rebalance receive invoice")
+			return "", "", err
+		}
+		receivePaymentRequest = mppInvoice.PaymentRequest
+	} else {
+		receiveInvoice, err := api.svc.GetTransactionsService().MakeInvoice(ctx, rebalanceChannelRequest.AmountSat*1000, "Alby Hub Rebalance through "+rebalanceChannelRequest.ReceiveThroughNodePubkey, "", 0, receiveMetadata, api.svc.GetLNClient(), nil, nil)
+		if err != nil {
+			logger.Logger.WithError(err).Error("failed to generate rebalance receive invoice")
+			return "", "", err
+		}
+		receivePaymentRequest = receiveInvoice.PaymentRequest
+	}
+
+	type rspCreateOrderRequest struct {
+		Token                   string `json:"token"`
+		PayRequest              string `json:"pay_request"`
+		PayThroughThisPublicKey string `json:"pay_through_this_public_key"`
+		MaxFeeSat               uint64 `json:"max_fee_sat,omitempty"`
+		Mpp                     bool   `json:"mpp,omitempty"`
+	}
+
+	newRspCreateOrderRequest := rspCreateOrderRequest{
+		Token:                   "alby-hub",
+		PayRequest:              receivePaymentRequest,
+		PayThroughThisPublicKey: rebalanceChannelRequest.ReceiveThroughNodePubkey,
+		MaxFeeSat:               rebalanceChannelRequest.maxFeeSat(),
+		Mpp:                     rebalanceChannelRequest.usesMPP(),
+	}
+
+	payloadBytes, err := json.Marshal(newRspCreateOrderRequest)
+	if err != nil {
+		logger.Logger.WithError(err).WithFields(logrus.Fields{
+			"request": newRspCreateOrderRequest,
+		}).Error("Failed to marshal new rebalance request")
+		return "", "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, api.cfg.GetEnv().RebalanceServiceUrl+"/api/rebalance/v1/create_order", bytes.NewReader(payloadBytes))
+	if err != nil {
+		logger.Logger.WithError(err).WithFields(logrus.Fields{
+			"request": newRspCreateOrderRequest,
+		}).Error("Failed to create new rebalance request")
+		return "", "", err
+	}
+
+	setDefaultRequestHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := http.Client{Timeout: time.Second * 60}
+	res, err := client.Do(req)
+	if err != nil {
+		logger.Logger.WithError(err).WithFields(logrus.Fields{
+			"request": newRspCreateOrderRequest,
+		}).Error("Failed to request new rebalance order")
+		return "", "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		logger.Logger.WithError(err).WithFields(logrus.Fields{
+			"request": newRspCreateOrderRequest,
+		}).Error("Failed to read response body")
+		return "", "", fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if res.StatusCode >= 300 {
+		logger.Logger.WithFields(logrus.Fields{
+			"request":    newRspCreateOrderRequest,
+			"body":       string(body),
+			"statusCode": res.StatusCode,
+		}).Error("rebalance create_order endpoint returned non-success code")
+		return "", "", fmt.Errorf("rebalance create_order endpoint returned non-success code: %s", string(body))
+	}
+
+	type rspRebalanceCreateOrderResponse struct {
+		OrderId    string `json:"order_id"`
+		PayRequest string `json:"pay_request"`
+		FeeSat     uint64 `json:"fee_sat"`
+	}
+
+	var rebalanceCreateOrderResponse rspRebalanceCreateOrderResponse
+	if err := json.Unmarshal(body, &rebalanceCreateOrderResponse); err != nil {
+		logger.Logger.WithError(err).WithFields(logrus.Fields{
+			"request": newRspCreateOrderRequest,
+		}).Error("Failed to deserialize json")
+		return "", "", fmt.Errorf("failed to deserialize json from rebalance create order response: %s", string(body))
+	}
+
+	logger.Logger.WithField("response", rebalanceCreateOrderResponse).Info("New rebalance order created")
+
+	if maxFeeSat := rebalanceChannelRequest.maxFeeSat(); maxFeeSat > 0 && rebalanceCreateOrderResponse.FeeSat > maxFeeSat {
+		logger.Logger.WithFields(logrus.Fields{
+			"order_id":    rebalanceCreateOrderResponse.OrderId,
+			"fee_sat":     rebalanceCreateOrderResponse.FeeSat,
+			"max_fee_sat": maxFeeSat,
+		}).Error("Rebalance order fee exceeds configured maximum, aborting before payment")
+		return "", "", fmt.Errorf("rebalance order fee %d sat exceeds max fee %d sat", rebalanceCreateOrderResponse.FeeSat, maxFeeSat)
+	}
+
+	if _, err := decodepay.Decodepay(rebalanceCreateOrderResponse.PayRequest); err != nil {
+		logger.Logger.WithError(err).Error("Failed to decode bolt11 invoice")
+		return "", "", fmt.Errorf("failed to decode bolt11 invoice: %w", err)
+	}
+
+	return rebalanceCreateOrderResponse.PayRequest, rebalanceCreateOrderResponse.OrderId, nil
+}